@@ -0,0 +1,52 @@
+// Package auth gates poll creation behind per-user TOTP enrollment, so that
+// only verified Slack users can post polls into channels a workspace's
+// AUTH_CONFIG marks as sensitive.
+package auth
+
+import (
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Authorizer decides whether userID may create a poll in channelID.
+type Authorizer interface {
+	IsAuthorized(userID, channelID string) bool
+}
+
+// ChannelConfig lists the channels that require an authorized session
+// before a user can create a poll there.
+type ChannelConfig struct {
+	SensitiveChannels []string `yaml:"sensitive_channels"`
+}
+
+// RequiresAuth reports whether channelID is on the sensitive-channels list.
+func (c ChannelConfig) RequiresAuth(channelID string) bool {
+	for _, id := range c.SensitiveChannels {
+		if id == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadChannelConfig reads the YAML channel allowlist from the path in
+// AUTH_CONFIG. An unset AUTH_CONFIG returns an empty ChannelConfig, under
+// which no channel requires authorization.
+func LoadChannelConfig() (ChannelConfig, error) {
+	path := os.Getenv("AUTH_CONFIG")
+	if path == "" {
+		return ChannelConfig{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ChannelConfig{}, err
+	}
+
+	var cfg ChannelConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return ChannelConfig{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+// maxAuthAttempts/authLockoutDuration throttle "/poll auth <code>": after
+// this many consecutive wrong codes, a user is locked out of further
+// attempts for authLockoutDuration, so a 6-digit TOTP can't be brute-forced.
+const (
+	maxAuthAttempts     = 5
+	authLockoutDuration = 5 * time.Minute
+)
+
+// ErrLockedOut is returned by VerifyCode when userID has failed too many
+// consecutive code checks and is still within their lockout window.
+var ErrLockedOut = errors.New("auth: too many failed codes; locked out")
+
+// TOTPEnroller is an Authorizer backed by per-user TOTP enrollment: a user
+// runs "/poll enroll" once to receive a provisioning URI, then "/poll auth
+// <code>" to prove they hold the secret before they're authorized for TTL.
+type TOTPEnroller struct {
+	Store    store.PollStore
+	Issuer   string
+	TTL      time.Duration
+	Channels ChannelConfig
+}
+
+// IsAuthorized reports whether userID may create a poll in channelID: either
+// the channel isn't on the sensitive-channels list, or userID has an
+// unexpired authorization from a prior VerifyCode.
+func (a *TOTPEnroller) IsAuthorized(userID, channelID string) bool {
+	if !a.Channels.RequiresAuth(channelID) {
+		return true
+	}
+	ok, err := a.Store.IsSessionAuthorized(userID)
+	return err == nil && ok
+}
+
+// Enroll generates and persists a new TOTP secret for userID, returning the
+// otpauth:// URI for them to add to an authenticator app.
+func (a *TOTPEnroller) Enroll(userID string) (string, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return "", fmt.Errorf("auth: generating secret: %w", err)
+	}
+	if err := a.Store.SaveAuthSecret(userID, secret); err != nil {
+		return "", fmt.Errorf("auth: saving secret: %w", err)
+	}
+	return provisioningURI(a.Issuer, userID, secret), nil
+}
+
+// VerifyCode checks code against userID's enrolled secret and, if it
+// matches, authorizes them for a.TTL. It reports false, without error, if
+// userID hasn't enrolled yet or the code doesn't check out, and returns
+// ErrLockedOut if they've failed maxAuthAttempts codes in a row.
+func (a *TOTPEnroller) VerifyCode(userID, code string) (bool, error) {
+	lockedUntil, err := a.Store.LockedUntil(userID)
+	if err != nil {
+		return false, err
+	}
+	if time.Now().Before(lockedUntil) {
+		return false, ErrLockedOut
+	}
+
+	secret, ok, err := a.Store.GetAuthSecret(userID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	valid, err := validateCode(secret, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if !valid {
+		if _, err := a.Store.RecordAuthFailure(userID, maxAuthAttempts, authLockoutDuration); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if err := a.Store.ResetAuthFailures(userID); err != nil {
+		return false, err
+	}
+	return true, a.Store.Authorize(userID, time.Now().Add(a.TTL))
+}
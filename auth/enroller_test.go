@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+func newTestEnroller(t *testing.T) (*TOTPEnroller, string) {
+	t.Helper()
+
+	enroller := &TOTPEnroller{Store: store.NewMemoryStore(), Issuer: "Test", TTL: time.Hour}
+	secret, err := generateSecret()
+	if err != nil {
+		t.Fatalf("generateSecret: %v", err)
+	}
+	if err := enroller.Store.SaveAuthSecret("U1", secret); err != nil {
+		t.Fatalf("SaveAuthSecret: %v", err)
+	}
+	return enroller, secret
+}
+
+func TestVerifyCodeAcceptsValidCode(t *testing.T) {
+	enroller, secret := newTestEnroller(t)
+	enroller.Channels = ChannelConfig{SensitiveChannels: []string{"C1"}}
+	if enroller.IsAuthorized("U1", "C1") {
+		t.Fatal("IsAuthorized: got true before VerifyCode in a sensitive channel")
+	}
+
+	code, err := generateCode(secret, uint64(time.Now().Unix())/uint64(totpStep.Seconds()))
+	if err != nil {
+		t.Fatalf("generateCode: %v", err)
+	}
+
+	ok, err := enroller.VerifyCode("U1", code)
+	if err != nil {
+		t.Fatalf("VerifyCode: %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyCode: got false, want true for a valid code")
+	}
+	if authorized := enroller.IsAuthorized("U1", "C1"); !authorized {
+		t.Error("IsAuthorized: got false after a successful VerifyCode")
+	}
+}
+
+func TestVerifyCodeLocksOutAfterMaxAttempts(t *testing.T) {
+	enroller, _ := newTestEnroller(t)
+
+	for i := 0; i < maxAuthAttempts-1; i++ {
+		ok, err := enroller.VerifyCode("U1", "000000")
+		if err != nil {
+			t.Fatalf("VerifyCode attempt %d: %v", i, err)
+		}
+		if ok {
+			t.Fatalf("VerifyCode attempt %d: got true for a wrong code", i)
+		}
+	}
+
+	// The attempt that reaches maxAuthAttempts locks the user out.
+	if _, err := enroller.VerifyCode("U1", "000000"); err != nil {
+		t.Fatalf("VerifyCode (final wrong attempt): %v", err)
+	}
+
+	if _, err := enroller.VerifyCode("U1", "000000"); !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("VerifyCode after lockout: got err %v, want ErrLockedOut", err)
+	}
+}
+
+func TestVerifyCodeResetsFailuresAfterSuccess(t *testing.T) {
+	enroller, secret := newTestEnroller(t)
+
+	for i := 0; i < maxAuthAttempts-1; i++ {
+		if _, err := enroller.VerifyCode("U1", "000000"); err != nil {
+			t.Fatalf("VerifyCode attempt %d: %v", i, err)
+		}
+	}
+
+	code, err := generateCode(secret, uint64(time.Now().Unix())/uint64(totpStep.Seconds()))
+	if err != nil {
+		t.Fatalf("generateCode: %v", err)
+	}
+	ok, err := enroller.VerifyCode("U1", code)
+	if err != nil {
+		t.Fatalf("VerifyCode (valid code): %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyCode: got false, want true for a valid code after prior failures")
+	}
+
+	// The failure count should have reset, so another maxAuthAttempts-1
+	// wrong codes shouldn't lock the user out yet.
+	for i := 0; i < maxAuthAttempts-1; i++ {
+		if _, err := enroller.VerifyCode("U1", "000000"); err != nil {
+			t.Fatalf("VerifyCode attempt %d after reset: %v", i, err)
+		}
+	}
+	if _, err := enroller.VerifyCode("U1", code); errors.Is(err, ErrLockedOut) {
+		t.Fatal("VerifyCode: locked out even though failures should have reset after the prior success")
+	}
+}
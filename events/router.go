@@ -0,0 +1,72 @@
+// Package events dispatches Slack Events API callbacks to registered
+// handlers, independent of whether they arrived over the HTTP /events
+// endpoint or socket mode's EventTypeEventsAPI — both deliveries route
+// through the same EventRouter so behavior doesn't depend on deployment mode.
+package events
+
+import "github.com/slack-go/slack/slackevents"
+
+// Every handler also receives the originating workspace's team ID, taken
+// from the callback envelope, since the inner events themselves don't carry
+// it.
+type (
+	AppMentionHandler    func(teamID string, ev *slackevents.AppMentionEvent)
+	ReactionAddedHandler func(teamID string, ev *slackevents.ReactionAddedEvent)
+	MessageHandler       func(teamID string, ev *slackevents.MessageEvent)
+)
+
+// EventRouter holds the registered handlers for each inner event type it
+// understands.
+type EventRouter struct {
+	appMentionHandlers    []AppMentionHandler
+	reactionAddedHandlers []ReactionAddedHandler
+	messageHandlers       []MessageHandler
+}
+
+// NewEventRouter returns an EventRouter with no handlers registered.
+func NewEventRouter() *EventRouter {
+	return &EventRouter{}
+}
+
+// HandleAppMention registers h to run on every app_mention event.
+func (r *EventRouter) HandleAppMention(h AppMentionHandler) {
+	r.appMentionHandlers = append(r.appMentionHandlers, h)
+}
+
+// HandleReactionAdded registers h to run on every reaction_added event.
+func (r *EventRouter) HandleReactionAdded(h ReactionAddedHandler) {
+	r.reactionAddedHandlers = append(r.reactionAddedHandlers, h)
+}
+
+// HandleMessage registers h to run on every message.channels event.
+func (r *EventRouter) HandleMessage(h MessageHandler) {
+	r.messageHandlers = append(r.messageHandlers, h)
+}
+
+// Route dispatches a parsed Events API callback to the handlers registered
+// for its inner event's type.
+func (r *EventRouter) Route(event slackevents.EventsAPIEvent) {
+	if event.Type != slackevents.CallbackEvent {
+		return
+	}
+
+	var teamID string
+	if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok {
+		teamID = callback.TeamID
+	}
+
+	switch ev := event.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		for _, h := range r.appMentionHandlers {
+			h(teamID, ev)
+		}
+	case *slackevents.ReactionAddedEvent:
+		for _, h := range r.reactionAddedHandlers {
+			h(teamID, ev)
+		}
+	case *slackevents.MessageEvent:
+		for _, h := range r.messageHandlers {
+			h(teamID, ev)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+// EventsHandler serves the Events API HTTP subscription endpoint, answering
+// Slack's URL verification handshake and otherwise routing callbacks through
+// Config.Events.
+func (c *Config) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := c.verifySigningSecret(r); err != nil {
+		log.Printf("Error verifying signing secret: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading events payload: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(body, slackevents.OptionNoVerifyToken())
+	if err != nil {
+		log.Printf("Error parsing event: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if event.Type == slackevents.URLVerification {
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			log.Printf("Error parsing URL verification challenge: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, challenge.Challenge)
+		return
+	}
+
+	c.Events.Route(event)
+}
+
+// EventsSocketHandler routes socket-mode Events API deliveries through the
+// same Config.Events router the HTTP endpoint uses.
+func (c *Config) EventsSocketHandler(evt *socketmode.Event, client *socketmode.Client) {
+	event, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		log.Printf("Ignored %+v\n", evt)
+		return
+	}
+
+	client.Ack(*evt.Request)
+	c.Events.Route(event)
+}
+
+// registerEventHandlers wires up Config.Events' handlers. It must run after
+// Config.Store and Config.Events are both set.
+func (c *Config) registerEventHandlers() {
+	c.Events.HandleAppMention(c.handleAppMention)
+	c.Events.HandleReactionAdded(c.handleReactionAdded)
+	c.Events.HandleMessage(c.handleMessageEvent)
+}
+
+// handleAppMention replies with a quick pointer to /poll.
+func (c *Config) handleAppMention(teamID string, ev *slackevents.AppMentionEvent) {
+	if _, err := c.sendMessage(ev.Channel, slack.MsgOptionText("Run `/poll` to start a new poll!", false)); err != nil {
+		log.Printf("Error replying to app_mention: %v", err)
+	}
+}
+
+// numberEmojis maps Slack's standard number-emoji reaction names to the
+// poll option index (0-based) they vote for.
+var numberEmojis = []string{
+	"one", "two", "three", "four", "five",
+	"six", "seven", "eight", "nine", "keycap_ten",
+}
+
+func emojiVoteIndex(reaction string) (int, bool) {
+	for i, name := range numberEmojis {
+		if name == reaction {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// handleReactionAdded turns a :one:-:keycap_ten: reaction on a poll message
+// into a vote for the corresponding option. Ranked-choice polls are skipped,
+// since a single reaction can't express a full ranking, and so are
+// anonymous polls, since a reaction is visible to every channel member.
+func (c *Config) handleReactionAdded(teamID string, ev *slackevents.ReactionAddedEvent) {
+	index, ok := emojiVoteIndex(ev.Reaction)
+	if !ok || ev.Item.Type != "message" {
+		return
+	}
+
+	poll, err := c.Store.GetPollByMessage(teamID, ev.Item.Channel, ev.Item.Timestamp)
+	if err != nil {
+		return
+	}
+	if poll.Type == store.TypeRanked || poll.Type == store.TypeAnonymous {
+		return
+	}
+	if index >= len(poll.Options) {
+		return
+	}
+
+	updated, err := c.castVote(pollActionValue(poll.ID, index), ev.User)
+	if err != nil {
+		log.Printf("Error casting reaction vote: %v", err)
+		return
+	}
+
+	if err := c.updateMessage(ev.Item.Channel, updated.MessageTS, slack.MsgOptionBlocks(buildPollBlocks(updated)...)); err != nil {
+		log.Printf("Error updating poll message after reaction vote: %v", err)
+	}
+}
+
+// closePollKeyword, posted by a poll's creator in its channel, auto-closes
+// any open poll they started there.
+const closePollKeyword = "!closepoll"
+
+// handleMessageEvent auto-closes the posting user's own open polls in the
+// channel a message was posted to, when that message contains
+// closePollKeyword. Polls created by other users are left alone.
+func (c *Config) handleMessageEvent(teamID string, ev *slackevents.MessageEvent) {
+	if !strings.Contains(ev.Text, closePollKeyword) {
+		return
+	}
+
+	polls, err := c.Store.ListOpenPolls(teamID)
+	if err != nil {
+		log.Printf("Error listing open polls: %v", err)
+		return
+	}
+
+	for _, poll := range polls {
+		if poll.ChannelID != ev.Channel || poll.CreatorID != ev.User {
+			continue
+		}
+		if err := c.closePoll(poll.TeamID, poll.ChannelID, poll.MessageTS); err != nil {
+			log.Printf("Error auto-closing poll: %v", err)
+		}
+	}
+}
@@ -3,21 +3,74 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/socketmode"
+
+	"github.com/ifo/slack-polls/auth"
+	"github.com/ifo/slack-polls/events"
+	"github.com/ifo/slack-polls/store"
+)
+
+// authSessionTTL is how long a successful "/poll auth <code>" authorizes a
+// user to create polls for.
+const authSessionTTL = time.Hour
+
+// pollCreateCallbackID identifies the "create a poll" modal so a view
+// submission can be routed without guessing at its shape.
+const pollCreateCallbackID = "poll_create"
+
+const (
+	minChoices = 2
+	maxChoices = 10
+
+	addChoiceBlockID  = "add_choice_block"
+	addChoiceActionID = "add_choice"
+
+	pollTypeBlockID = "poll_type"
 )
 
+// pollTypeLabels lists the poll types offered in the creation modal, in the
+// order they're shown, with store.TypeSingle as the default.
+var pollTypeLabels = []struct {
+	Type  store.Type
+	Label string
+}{
+	{store.TypeSingle, "Single choice"},
+	{store.TypeMulti, "Multiple choice"},
+	{store.TypeAnonymous, "Anonymous"},
+	{store.TypeRanked, "Ranked choice"},
+}
+
+// choicePlaceholders supplies a bit of personality to the first few choice
+// inputs; choices added beyond this just get a generic placeholder.
+var choicePlaceholders = []string{"2 hours", "3 days", "4 months", "5 years"}
+
+func choicePlaceholder(index int) string {
+	if index < len(choicePlaceholders) {
+		return choicePlaceholders[index]
+	}
+	return fmt.Sprintf("Option %d", index+1)
+}
+
 type Config struct {
 	Client           *slack.Client
 	SigningSecret    string
 	SocketModeClient *socketmode.Client
+	Store            store.PollStore
+	Events           *events.EventRouter
+	Auth             *auth.TOTPEnroller
 }
 
 func main() {
@@ -35,6 +88,25 @@ func main() {
 
 	config := Config{}
 
+	pollStore, err := store.NewFromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	config.Store = pollStore
+	config.Events = events.NewEventRouter()
+	config.registerEventHandlers()
+
+	channels, err := auth.LoadChannelConfig()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	config.Auth = &auth.TOTPEnroller{
+		Store:    pollStore,
+		Issuer:   "Slack Polls",
+		TTL:      authSessionTTL,
+		Channels: channels,
+	}
+
 	if apiKey, isSet = os.LookupEnv("API_KEY"); !isSet {
 		log.Fatalln("No API_KEY set")
 	}
@@ -52,6 +124,8 @@ func main() {
 
 		http.HandleFunc("/slash", config.SlashHandler)
 		http.HandleFunc("/modal", config.ModalHandler)
+		http.HandleFunc("/events", config.EventsHandler)
+		http.HandleFunc("/polls/", config.PollResultsHandler)
 
 		log.Printf("starting server on port %s\n", port)
 		log.Fatalln(http.ListenAndServe(":"+port, nil))
@@ -74,9 +148,10 @@ func main() {
 	socketmodeHandler.HandleSlashCommand("/poll", config.PollSocketHandler)
 	socketmodeHandler.HandleSlashCommand("/slash", config.SlashSocketHandler)
 	socketmodeHandler.Handle(socketmode.EventTypeInteractive, config.ModalSocketHandler)
+	socketmodeHandler.Handle(socketmode.EventTypeEventsAPI, config.EventsSocketHandler)
 
 	log.Print("starting socket mode")
-	err := socketmodeHandler.RunEventLoop()
+	err = socketmodeHandler.RunEventLoop()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -111,11 +186,7 @@ func (c *Config) SlashHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch s.Command {
 	case "/poll":
-		modalRequest := generateModalRequest()
-		_, err = c.Client.OpenView(s.TriggerID, modalRequest)
-		if err != nil {
-			log.Printf("Error opening view: %v", err)
-		}
+		c.handlePollCommand(s.Text, s.TriggerID, s.TeamID, s.ChannelID, s.UserID)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -133,11 +204,7 @@ func (c *Config) PollSocketHandler(evt *socketmode.Event, client *socketmode.Cli
 
 	client.Debugf("Slash command received: %+v", cmd)
 
-	modalRequest := generateModalRequest()
-	_, err := c.Client.OpenView(cmd.TriggerID, modalRequest)
-	if err != nil {
-		log.Printf("Error opening view: %v", err)
-	}
+	c.handlePollCommand(cmd.Text, cmd.TriggerID, cmd.TeamID, cmd.ChannelID, cmd.UserID)
 }
 
 func (c *Config) SlashSocketHandler(evt *socketmode.Event, client *socketmode.Client) {
@@ -151,11 +218,7 @@ func (c *Config) SlashSocketHandler(evt *socketmode.Event, client *socketmode.Cl
 
 	client.Debugf("Slash command received: %+v", cmd)
 
-	modalRequest := generateModalRequest()
-	_, err := c.Client.OpenView(cmd.TriggerID, modalRequest)
-	if err != nil {
-		log.Printf("Error opening view: %v", err)
-	}
+	c.handlePollCommand(cmd.Text, cmd.TriggerID, cmd.TeamID, cmd.ChannelID, cmd.UserID)
 }
 
 func (c *Config) ModalSocketHandler(evt *socketmode.Event, client *socketmode.Client) {
@@ -171,54 +234,44 @@ func (c *Config) ModalSocketHandler(evt *socketmode.Event, client *socketmode.Cl
 
 	switch callback.Type {
 	case slack.InteractionTypeBlockActions:
-		blockSetIndex := 2
-		messageTimestamp := callback.Message.Timestamp
-		userToAdd := "<@" + callback.User.ID + ">"
-		channel := callback.Channel.ID
-		optionSelected, _ := strconv.Atoi(callback.ActionCallback.BlockActions[0].Value)
-		newMessageBlocks := callback.Message.Msg.Blocks
+		if callback.View.CallbackID == pollCreateCallbackID {
+			c.handleAddChoice(callback.View)
+			return
+		}
 
-		groupTexts := []string{}
-		for _, i := range []int{1, 3, 5, 7} {
-			groupTexts = append(groupTexts, newMessageBlocks.BlockSet[blockSetIndex].(*slack.SectionBlock).Fields[i].Text)
+		channel := callback.Channel.ID
+		action := callback.ActionCallback.BlockActions[0]
+		if action.ActionID == downloadResultsActionID {
+			c.handleDownloadResults(channel, callback.User.ID, action.Value)
+			return
 		}
-		groupTexts = updateGroups(userToAdd, optionSelected-1, groupTexts)
-		for k, v := range map[int]int{1: 0, 3: 1, 5: 2, 7: 3} {
-			newMessageBlocks.BlockSet[blockSetIndex].(*slack.SectionBlock).Fields[k].Text = groupTexts[v]
+
+		poll, err := c.handleVoteAction(action, callback.User.ID)
+		if err != nil {
+			log.Printf("Error casting vote: %v", err)
+			return
 		}
 
-		if err := c.updateMessage(channel, messageTimestamp, slack.MsgOptionBlocks(newMessageBlocks.BlockSet...)); err != nil {
+		if err := c.updateMessage(channel, poll.MessageTS, slack.MsgOptionBlocks(buildPollBlocks(poll)...)); err != nil {
 			log.Printf("API update message error: %v", err)
 		}
 		return
 	case slack.InteractionTypeViewSubmission:
-		buttons := []*slack.ButtonBlockElement{}
-		textBlocks := []*slack.TextBlockObject{}
-		for _, numStr := range []string{"1", "2", "3", "4"} {
-			str := callback.View.State.Values["choice"+numStr]["choice"+numStr].Value
-			text := slack.NewTextBlockObject("plain_text", str, false, false)
-			textBlocks = append(textBlocks, text, slack.NewTextBlockObject("mrkdwn", ":", false, false)) // turns out mrkdwn is the key
-			button := slack.NewButtonBlockElement("actionID"+numStr, numStr, text)
-			buttons = append(buttons, button)
-		}
-		actionBlock := slack.NewActionBlock("", buttons[0], buttons[1], buttons[2], buttons[3])
-		sectionBlock := slack.SectionBlock{
-			Type:   slack.MBTSection,
-			Fields: textBlocks,
-		}
-		question := callback.View.State.Values["question"]["question"].Value
-		headerText := slack.NewTextBlockObject("plain_text", question, true, false)
-		headerBlock := slack.SectionBlock{
-			Type: slack.MBTSection,
-			Text: headerText,
+		if callback.View.CallbackID != pollCreateCallbackID {
+			return
 		}
+
+		poll := pollFromSubmission(callback.View.State.Values)
 		channel := callback.View.State.Values["channel"]["channelActionID"].SelectedConversation
 		if channel == "" {
 			channel = callback.User.ID
 		}
+		poll.ChannelID = channel
+		poll.TeamID = callback.Team.ID
+		poll.CreatorID = callback.User.ID
 
-		if err := c.sendMessage(channel, slack.MsgOptionBlocks(headerBlock, actionBlock, sectionBlock)); err != nil {
-			return
+		if err := c.createAndSendPoll(poll); err != nil {
+			log.Printf("Error creating poll: %v", err)
 		}
 	default:
 	}
@@ -226,10 +279,6 @@ func (c *Config) ModalSocketHandler(evt *socketmode.Event, client *socketmode.Cl
 
 func generateModalRequest() slack.ModalViewRequest {
 	question := makeTextInputBlock("Name of Post", "It's time to poll!", "question", "question")
-	choice1 := makeTextInputBlock("Choice 1", "2 hours", "choice1", "choice1")
-	choice2 := makeTextInputBlock("Choice 2", "3 days", "choice2", "choice2")
-	choice3 := makeTextInputBlock("Choice 3", "4 months", "choice3", "choice3")
-	choice4 := makeTextInputBlock("Choice 4", "5 years", "choice4", "choice4")
 	channelSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeConversations, slack.NewTextBlockObject("plain_text", "channel to post in", false, false), "channelActionID")
 	channelSelect.InitialConversation = os.Getenv("INITIAL_CHANNEL") // This should be the main channel ID
 	channel := slack.NewInputBlock("channel", slack.NewTextBlockObject("plain_text", "channel to post in", false, false), slack.NewTextBlockObject("plain_text", " ", false, false), channelSelect)
@@ -239,26 +288,145 @@ func generateModalRequest() slack.ModalViewRequest {
 	closeText := slack.NewTextBlockObject("plain_text", "nvm", false, false)
 	submitText := slack.NewTextBlockObject("plain_text", "Party time!", false, false)
 
-	blocks := slack.Blocks{
-		BlockSet: []slack.Block{
-			question,
-			choice1,
-			choice2,
-			choice3,
-			choice4,
-			channel,
-		},
-	}
+	blockSet := []slack.Block{question, pollTypeBlock()}
+	blockSet = append(blockSet, makeChoiceBlocks(minChoices)...)
+	blockSet = append(blockSet, addChoiceActionBlock(), channel)
 
 	var modalRequest slack.ModalViewRequest
 	modalRequest.Type = slack.ViewType("modal")
+	modalRequest.CallbackID = pollCreateCallbackID
 	modalRequest.Title = titleText
 	modalRequest.Close = closeText
 	modalRequest.Submit = submitText
-	modalRequest.Blocks = blocks
+	modalRequest.Blocks = slack.Blocks{BlockSet: blockSet}
 	return modalRequest
 }
 
+// pollTypeBlock is the radio-button input used to pick single/multi/
+// anonymous/ranked voting semantics, defaulting to single choice.
+func pollTypeBlock() *slack.InputBlock {
+	options := make([]*slack.OptionBlockObject, len(pollTypeLabels))
+	for i, l := range pollTypeLabels {
+		label := slack.NewTextBlockObject("plain_text", l.Label, false, false)
+		options[i] = slack.NewOptionBlockObject(string(l.Type), label, nil)
+	}
+
+	radios := slack.NewRadioButtonsBlockElement(pollTypeBlockID, options...)
+	radios.InitialOption = options[0]
+
+	label := slack.NewTextBlockObject("plain_text", "Poll type", false, false)
+	hint := slack.NewTextBlockObject("plain_text", " ", false, false)
+	return slack.NewInputBlock(pollTypeBlockID, label, hint, radios)
+}
+
+// parsePollType maps a poll_type radio value back to a store.Type, defaulting
+// to single choice for an empty or unrecognized value.
+func parsePollType(value string) store.Type {
+	for _, l := range pollTypeLabels {
+		if string(l.Type) == value {
+			return l.Type
+		}
+	}
+	return store.TypeSingle
+}
+
+// makeChoiceBlocks builds n "Choice N" input blocks, numbered starting at 1.
+func makeChoiceBlocks(n int) []slack.Block {
+	blocks := make([]slack.Block, n)
+	for i := 0; i < n; i++ {
+		blocks[i] = makeChoiceBlock(i)
+	}
+	return blocks
+}
+
+// makeChoiceBlock builds the input block for the choice at index (0-based).
+func makeChoiceBlock(index int) *slack.InputBlock {
+	num := strconv.Itoa(index + 1)
+	return makeTextInputBlock("Choice "+num, choicePlaceholder(index), "choice"+num, "choice"+num)
+}
+
+// addChoiceActionBlock is the "Add another option" button shown below the
+// current choices, up to maxChoices.
+func addChoiceActionBlock() *slack.ActionBlock {
+	text := slack.NewTextBlockObject("plain_text", "Add another option", false, false)
+	button := slack.NewButtonBlockElement(addChoiceActionID, "add", text)
+	return slack.NewActionBlock(addChoiceBlockID, button)
+}
+
+// countChoiceBlocks reports how many choice input blocks are present in a
+// modal's current blocks.
+func countChoiceBlocks(blocks []slack.Block) int {
+	n := 0
+	for _, b := range blocks {
+		if ib, ok := b.(*slack.InputBlock); ok && strings.HasPrefix(ib.BlockID, "choice") {
+			n++
+		}
+	}
+	return n
+}
+
+// nextChoiceModal returns the modal view with one more choice block appended
+// ahead of the "Add another option" button, and whether there was room to add
+// one. Existing blocks keep their block IDs so Slack preserves their values.
+func nextChoiceModal(view slack.View) (slack.ModalViewRequest, bool) {
+	count := countChoiceBlocks(view.Blocks.BlockSet)
+	if count >= maxChoices {
+		return slack.ModalViewRequest{}, false
+	}
+
+	newBlockSet := make([]slack.Block, 0, len(view.Blocks.BlockSet)+1)
+	for _, b := range view.Blocks.BlockSet {
+		if ab, ok := b.(*slack.ActionBlock); ok && ab.BlockID == addChoiceBlockID {
+			newBlockSet = append(newBlockSet, makeChoiceBlock(count))
+			if count+1 < maxChoices {
+				newBlockSet = append(newBlockSet, b)
+			}
+			continue
+		}
+		newBlockSet = append(newBlockSet, b)
+	}
+
+	return slack.ModalViewRequest{
+		Type:       slack.ViewType("modal"),
+		CallbackID: view.CallbackID,
+		Title:      view.Title,
+		Close:      view.Close,
+		Submit:     view.Submit,
+		Blocks:     slack.Blocks{BlockSet: newBlockSet},
+	}, true
+}
+
+// pollFromSubmission builds a poll (minus its channel/team/creator, which the
+// caller fills in) from the raw values of a poll-creation view submission.
+func pollFromSubmission(values map[string]map[string]slack.BlockAction) *store.Poll {
+	question := values["question"]["question"].Value
+	pollType := parsePollType(values[pollTypeBlockID][pollTypeBlockID].SelectedOption.Value)
+
+	var options []string
+	for i := 1; ; i++ {
+		blockID := "choice" + strconv.Itoa(i)
+		action, ok := values[blockID][blockID]
+		if !ok {
+			break
+		}
+		options = append(options, action.Value)
+	}
+
+	votes := make([]map[string]bool, len(options))
+	for i := range votes {
+		votes[i] = make(map[string]bool)
+	}
+
+	return &store.Poll{
+		Question:  question,
+		Type:      pollType,
+		Options:   options,
+		Votes:     votes,
+		Ballots:   make(map[string][]int),
+		CreatedAt: time.Now(),
+	}
+}
+
 func makeTextInputBlock(title, placeholder, returnName, blockName string) *slack.InputBlock {
 	text := slack.NewTextBlockObject("plain_text", title, false, false)
 	emptyText := slack.NewTextBlockObject("plain_text", " ", false, false)
@@ -286,55 +454,46 @@ func (c *Config) ModalHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch i.Type {
 	case slack.InteractionTypeBlockActions:
-		blockSetIndex := 2
-		messageTimestamp := i.Message.Timestamp
-		userToAdd := "<@" + i.User.ID + ">"
-		channel := i.Channel.ID
-		optionSelected, _ := strconv.Atoi(i.ActionCallback.BlockActions[0].Value)
-		newMessageBlocks := i.Message.Msg.Blocks
+		if i.View.CallbackID == pollCreateCallbackID {
+			c.handleAddChoice(i.View)
+			return
+		}
 
-		groupTexts := []string{}
-		for _, i := range []int{1, 3, 5, 7} {
-			groupTexts = append(groupTexts, newMessageBlocks.BlockSet[blockSetIndex].(*slack.SectionBlock).Fields[i].Text)
+		channel := i.Channel.ID
+		action := i.ActionCallback.BlockActions[0]
+		if action.ActionID == downloadResultsActionID {
+			c.handleDownloadResults(channel, i.User.ID, action.Value)
+			return
 		}
-		groupTexts = updateGroups(userToAdd, optionSelected-1, groupTexts)
-		for k, v := range map[int]int{1: 0, 3: 1, 5: 2, 7: 3} {
-			newMessageBlocks.BlockSet[blockSetIndex].(*slack.SectionBlock).Fields[k].Text = groupTexts[v]
+
+		poll, err := c.handleVoteAction(action, i.User.ID)
+		if err != nil {
+			log.Printf("Error casting vote: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
 
-		if err := c.updateMessage(channel, messageTimestamp, slack.MsgOptionBlocks(newMessageBlocks.BlockSet...)); err != nil {
+		if err := c.updateMessage(channel, poll.MessageTS, slack.MsgOptionBlocks(buildPollBlocks(poll)...)); err != nil {
 			log.Printf("API update message error: %v", err)
 			w.WriteHeader(http.StatusUnauthorized)
 		}
 		return
 	case slack.InteractionTypeViewSubmission:
-		buttons := []*slack.ButtonBlockElement{}
-		textBlocks := []*slack.TextBlockObject{}
-		for _, numStr := range []string{"1", "2", "3", "4"} {
-			str := i.View.State.Values["choice"+numStr]["choice"+numStr].Value
-			text := slack.NewTextBlockObject("plain_text", str, false, false)
-			textBlocks = append(textBlocks, text, slack.NewTextBlockObject("mrkdwn", ":", false, false)) // turns out mrkdwn is the key
-			button := slack.NewButtonBlockElement("actionID"+numStr, numStr, text)
-			buttons = append(buttons, button)
-		}
-		actionBlock := slack.NewActionBlock("", buttons[0], buttons[1], buttons[2], buttons[3])
-		sectionBlock := slack.SectionBlock{
-			Type:   slack.MBTSection,
-			Fields: textBlocks,
-		}
-		question := i.View.State.Values["question"]["question"].Value
-		headerText := slack.NewTextBlockObject("plain_text", question, true, false)
-		headerBlock := slack.SectionBlock{
-			Type: slack.MBTSection,
-			Text: headerText,
+		if i.View.CallbackID != pollCreateCallbackID {
+			return
 		}
+
+		poll := pollFromSubmission(i.View.State.Values)
 		channel := i.View.State.Values["channel"]["channelActionID"].SelectedConversation
 		if channel == "" {
 			channel = i.User.ID
 		}
+		poll.ChannelID = channel
+		poll.TeamID = i.Team.ID
+		poll.CreatorID = i.User.ID
 
-		if err := c.sendMessage(channel, slack.MsgOptionBlocks(headerBlock, actionBlock, sectionBlock)); err != nil {
-			log.Printf("API post message error: %v", err)
+		if err := c.createAndSendPoll(poll); err != nil {
+			log.Printf("Error creating poll: %v", err)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -342,9 +501,121 @@ func (c *Config) ModalHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (c *Config) sendMessage(channel string, opts ...slack.MsgOption) error {
-	_, _, err := c.Client.PostMessage(channel, opts...)
-	return err
+const (
+	// pollCloseSubcommand closes an open poll: "/poll close <message-ts>".
+	pollCloseSubcommand = "close"
+	// pollEnrollSubcommand starts TOTP enrollment: "/poll enroll".
+	pollEnrollSubcommand = "enroll"
+	// pollAuthSubcommand verifies a TOTP code: "/poll auth <code>".
+	pollAuthSubcommand = "auth"
+)
+
+// handlePollCommand runs the /poll slash command: no arguments opens the
+// poll-creation modal, "close <ts>" finalizes an open poll, "enroll" and
+// "auth <code>" run TOTP enrollment. Only opening the creation modal is
+// gated by Config.Auth: channels on the AUTH_CONFIG allowlist require
+// userID to have authorized with "/poll auth <code>" first.
+func (c *Config) handlePollCommand(text, triggerID, teamID, channelID, userID string) {
+	subcommand, args := parsePollCommand(text)
+	switch subcommand {
+	case "":
+		if !c.Auth.IsAuthorized(userID, channelID) {
+			c.sendEphemeral(channelID, userID, "This channel requires authorization to create polls. Run `/poll enroll`, then `/poll auth <code>` from your authenticator app.")
+			return
+		}
+		modalRequest := generateModalRequest()
+		if _, err := c.Client.OpenView(triggerID, modalRequest); err != nil {
+			log.Printf("Error opening view: %v", err)
+		}
+	case pollEnrollSubcommand:
+		c.handlePollEnroll(channelID, userID)
+	case pollAuthSubcommand:
+		c.handlePollAuth(channelID, userID, args)
+	case pollCloseSubcommand:
+		if err := c.closePoll(teamID, channelID, args); err != nil {
+			log.Printf("Error closing poll: %v", err)
+		}
+	case pollResultsSubcommand:
+		c.handleDownloadResults(channelID, userID, args)
+	default:
+		log.Printf("Unknown /poll subcommand: %q", subcommand)
+	}
+}
+
+// handlePollEnroll runs "/poll enroll": it generates a TOTP secret for
+// userID and DMs them the provisioning URI to scan into an authenticator
+// app.
+func (c *Config) handlePollEnroll(channelID, userID string) {
+	uri, err := c.Auth.Enroll(userID)
+	if err != nil {
+		log.Printf("Error enrolling %s: %v", userID, err)
+		c.sendEphemeral(channelID, userID, "Something went wrong enrolling you — try again shortly.")
+		return
+	}
+	text := fmt.Sprintf("Scan this into your authenticator app, then run `/poll auth <code>`:\n%s", uri)
+	if _, err := c.sendMessage(userID, slack.MsgOptionText(text, false)); err != nil {
+		log.Printf("Error sending provisioning URI to %s: %v", userID, err)
+	}
+}
+
+// handlePollAuth runs "/poll auth <code>": it verifies code against userID's
+// enrolled TOTP secret and, if it checks out, authorizes them.
+func (c *Config) handlePollAuth(channelID, userID, code string) {
+	ok, err := c.Auth.VerifyCode(userID, code)
+	if errors.Is(err, auth.ErrLockedOut) {
+		c.sendEphemeral(channelID, userID, "Too many wrong codes — try again in a few minutes.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying code for %s: %v", userID, err)
+	}
+	if ok {
+		c.sendEphemeral(channelID, userID, "You're authorized — go ahead and run `/poll`.")
+		return
+	}
+	c.sendEphemeral(channelID, userID, "That code didn't check out. Run `/poll enroll` if you haven't, then try `/poll auth <code>` again.")
+}
+
+// sendEphemeral posts text visibly only to userID in channel.
+func (c *Config) sendEphemeral(channel, userID, text string) {
+	if _, err := c.Client.PostEphemeral(channel, userID, slack.MsgOptionText(text, false)); err != nil {
+		log.Printf("Error sending ephemeral message to %s: %v", userID, err)
+	}
+}
+
+// parsePollCommand splits "/poll"'s text into a subcommand and its
+// remaining arguments. An empty or whitespace-only text has no subcommand.
+func parsePollCommand(text string) (subcommand, args string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ""
+	}
+	fields := strings.SplitN(text, " ", 2)
+	if len(fields) > 1 {
+		args = strings.TrimSpace(fields[1])
+	}
+	return fields[0], args
+}
+
+// closePoll finalizes the poll posted as messageTS and replaces its message
+// with a results summary.
+func (c *Config) closePoll(teamID, channelID, messageTS string) error {
+	poll, err := c.Store.GetPollByMessage(teamID, channelID, messageTS)
+	if err != nil {
+		return fmt.Errorf("looking up poll: %w", err)
+	}
+
+	if err := c.Store.ClosePoll(poll.ID); err != nil {
+		return fmt.Errorf("closing poll: %w", err)
+	}
+	poll.Open = false
+
+	return c.updateMessage(channelID, messageTS, slack.MsgOptionBlocks(buildResultsBlocks(poll)...))
+}
+
+func (c *Config) sendMessage(channel string, opts ...slack.MsgOption) (string, error) {
+	_, ts, err := c.Client.PostMessage(channel, opts...)
+	return ts, err
 }
 
 func (c *Config) updateMessage(channel, ts string, opts ...slack.MsgOption) error {
@@ -352,78 +623,271 @@ func (c *Config) updateMessage(channel, ts string, opts ...slack.MsgOption) erro
 	return err
 }
 
-func (c *Config) verifySigningSecret(r *http.Request) error {
-	verifier, err := slack.NewSecretsVerifier(r.Header, c.SigningSecret)
-	if err != nil {
-		return err
+// createAndSendPoll posts poll to its channel, then persists it together with
+// the resulting message timestamp so later votes can find it again.
+func (c *Config) createAndSendPoll(poll *store.Poll) error {
+	if poll.ID == "" {
+		poll.ID = uuid.NewString()
 	}
 
-	body, err := io.ReadAll(r.Body)
+	ts, err := c.sendMessage(poll.ChannelID, slack.MsgOptionBlocks(buildPollBlocks(poll)...))
 	if err != nil {
-		return err
+		return fmt.Errorf("sending poll message: %w", err)
 	}
-	// Need to use r.Body again when unmarshalling SlashCommand and InteractionCallback
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
+	poll.MessageTS = ts
 
-	verifier.Write(body)
-	return verifier.Ensure()
+	if err := c.Store.CreatePoll(poll); err != nil {
+		return fmt.Errorf("creating poll: %w", err)
+	}
+	return nil
+}
+
+// handleAddChoice re-renders the poll-creation modal with one more choice
+// input, in response to the "Add another option" button.
+func (c *Config) handleAddChoice(view slack.View) {
+	modalRequest, ok := nextChoiceModal(view)
+	if !ok {
+		return
+	}
+	if _, err := c.Client.UpdateView(modalRequest, "", view.Hash, view.ID); err != nil {
+		log.Printf("Error updating view: %v", err)
+	}
 }
 
-func appendUser(text, userID string) string {
-	if text == ":" {
-		return userID
+// handleVoteAction dispatches a message block action to castVote or, for a
+// ranked-choice poll's rank select menus, castRank.
+func (c *Config) handleVoteAction(action *slack.BlockAction, userID string) (*store.Poll, error) {
+	if isRankAction(action.ActionID) {
+		return c.castRank(strings.TrimPrefix(action.ActionID, rankActionPrefix), userID, action.SelectedOption.Value)
 	}
-	return text + ", " + userID
+	return c.castVote(action.Value, userID)
 }
 
-func updateGroups(user string, index int, groups []string) []string {
-	parsedGroups := make([][]string, 4)
-	userIndex := -1
-	for i := range groups {
-		parsedGroups[i] = strings.Split(groups[i], ", ")
-		if contains(user, parsedGroups[i]) {
-			userIndex = i
+// castVote records userID's vote for the poll/option encoded in actionValue
+// (see pollActionValue) and returns the poll's post-vote state. A multi-
+// choice poll just toggles that one option; every other type keeps the user
+// in at most one group, moving or removing them as needed.
+func (c *Config) castVote(actionValue, userID string) (*store.Poll, error) {
+	pollID, index, err := parsePollActionValue(actionValue)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := c.Store.GetPoll(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(poll.Options) {
+		return nil, errors.New("store: option index out of range")
+	}
+
+	if poll.Type == store.TypeMulti {
+		if poll.Votes[index][userID] {
+			err = c.Store.RemoveVote(pollID, index, userID)
+		} else {
+			err = c.Store.AddVote(pollID, index, userID)
+		}
+		if err != nil {
+			return nil, err
 		}
+		return c.Store.GetPoll(pollID)
 	}
 
-	// If the user isn't anywhere, add them to the index
-	if userIndex == -1 {
-		groups[index] = appendUser(groups[index], user)
-		return groups
+	currentIndex := -1
+	for i, voters := range poll.Votes {
+		if voters[userID] {
+			currentIndex = i
+			break
+		}
 	}
 
-	// if the user is in the same group, remove them from the group
-	parsedGroups[userIndex] = remove(user, parsedGroups[userIndex])
-	for i := range parsedGroups {
-		groups[i] = strings.Join(parsedGroups[i], ", ")
-		if groups[i] == "" {
-			groups[i] = ":" // always have some text
+	if currentIndex == index {
+		if err := c.Store.RemoveVote(pollID, index, userID); err != nil {
+			return nil, err
+		}
+	} else {
+		if currentIndex != -1 {
+			if err := c.Store.RemoveVote(pollID, currentIndex, userID); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.Store.AddVote(pollID, index, userID); err != nil {
+			return nil, err
 		}
 	}
 
-	// if the user is in a different group, remove them from that group and add them to the new one
-	if index != userIndex {
-		groups[index] = appendUser(groups[index], user)
+	return c.Store.GetPoll(pollID)
+}
+
+// castRank records userID's rank for the poll/option encoded in actionValue,
+// for a TypeRanked poll's per-option rank select menus.
+func (c *Config) castRank(actionValue, userID, rankValue string) (*store.Poll, error) {
+	pollID, index, err := parsePollActionValue(actionValue)
+	if err != nil {
+		return nil, err
 	}
-	return groups
+	rank, err := strconv.Atoi(rankValue)
+	if err != nil {
+		return nil, fmt.Errorf("malformed rank value %q: %w", rankValue, err)
+	}
+
+	poll, err := c.Store.GetPoll(pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	ballot := poll.Ballots[userID]
+	if ballot == nil {
+		ballot = make([]int, len(poll.Options))
+	}
+	// A rank can only belong to one option at a time: picking it for index
+	// steals it away from whichever other option last held it.
+	if rank > 0 {
+		for i, r := range ballot {
+			if i != index && r == rank {
+				ballot[i] = 0
+			}
+		}
+	}
+	ballot[index] = rank
+
+	if err := c.Store.SetBallot(pollID, userID, ballot); err != nil {
+		return nil, err
+	}
+	return c.Store.GetPoll(pollID)
 }
 
-func contains(text string, arr []string) bool {
-	for _, s := range arr {
-		if text == s {
-			return true
+// buildPollBlocks renders poll's current vote tallies as Slack blocks, the
+// same shape the poll was originally posted with. Ranked-choice polls get a
+// rank select menu per option instead of a vote button.
+func buildPollBlocks(poll *store.Poll) []slack.Block {
+	headerText := slack.NewTextBlockObject("plain_text", poll.Question, true, false)
+	headerBlock := slack.SectionBlock{
+		Type: slack.MBTSection,
+		Text: headerText,
+	}
+
+	elements := make([]slack.BlockElement, len(poll.Options))
+	fields := make([]*slack.TextBlockObject, 0, len(poll.Options)*2)
+	for i, option := range poll.Options {
+		numStr := strconv.Itoa(i + 1)
+		text := slack.NewTextBlockObject("plain_text", option, false, false)
+		if poll.Type == store.TypeRanked {
+			elements[i] = rankSelectElement(poll, i)
+		} else {
+			elements[i] = slack.NewButtonBlockElement("actionID"+numStr, pollActionValue(poll.ID, i), text)
 		}
+		fields = append(fields, text, slack.NewTextBlockObject("mrkdwn", fieldText(poll, i), false, false))
 	}
-	return false
+	actionBlock := slack.NewActionBlock("", elements...)
+
+	sectionBlock := slack.SectionBlock{
+		Type:   slack.MBTSection,
+		Fields: fields,
+	}
+
+	return []slack.Block{&headerBlock, actionBlock, &sectionBlock, downloadResultsBlock(poll)}
 }
 
-func remove(text string, arr []string) []string {
-	var index int
-	for i := range arr {
-		if text == arr[i] {
-			index = i
-			break
+// rankSelectElement is the 1..N rank picker shown for a ranked-choice poll's
+// option at index.
+func rankSelectElement(poll *store.Poll, index int) *slack.SelectBlockElement {
+	options := make([]*slack.OptionBlockObject, len(poll.Options))
+	for r := 1; r <= len(poll.Options); r++ {
+		label := slack.NewTextBlockObject("plain_text", strconv.Itoa(r), false, false)
+		options[r-1] = slack.NewOptionBlockObject(strconv.Itoa(r), label, nil)
+	}
+	placeholder := slack.NewTextBlockObject("plain_text", "Rank", false, false)
+	return slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, placeholder, rankActionID(poll.ID, index), options...)
+}
+
+// fieldText renders the section-block field shown next to an option: voter
+// mentions for single/multi polls, a bare count for anonymous polls, and a
+// first-choice tally for ranked polls.
+func fieldText(poll *store.Poll, index int) string {
+	switch poll.Type {
+	case store.TypeAnonymous:
+		return fmt.Sprintf("%d votes", len(poll.Votes[index]))
+	case store.TypeRanked:
+		return fmt.Sprintf("%d first-choice votes", firstChoiceTally(poll, index))
+	default:
+		return groupText(poll.Votes[index])
+	}
+}
+
+// firstChoiceTally counts how many ballots currently rank index as their
+// first choice.
+func firstChoiceTally(poll *store.Poll, index int) int {
+	count := 0
+	for _, ballot := range poll.Ballots {
+		if index < len(ballot) && ballot[index] == 1 {
+			count++
 		}
 	}
-	return append(arr[:index], arr[index+1:]...)
+	return count
+}
+
+// pollActionValue packs a poll ID and option index into a single button
+// value, so a vote can be resolved back to both without any message-text
+// round-tripping.
+func pollActionValue(pollID string, index int) string {
+	return pollID + ":" + strconv.Itoa(index)
+}
+
+func parsePollActionValue(value string) (pollID string, index int, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("malformed poll action value %q", value)
+	}
+	index, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed poll action value %q: %w", value, err)
+	}
+	return parts[0], index, nil
 }
+
+// rankActionID builds the action ID used for a ranked-choice option's rank
+// select menu, embedding the poll/option pair the same way pollActionValue
+// does for vote buttons.
+const rankActionPrefix = "rank:"
+
+func rankActionID(pollID string, index int) string {
+	return rankActionPrefix + pollActionValue(pollID, index)
+}
+
+func isRankAction(actionID string) bool {
+	return strings.HasPrefix(actionID, rankActionPrefix)
+}
+
+// groupText renders the voters for a single option as the mrkdwn field text
+// shown next to it, e.g. "<@U1>, <@U2>". An option with no voters renders as
+// ":" so the field is never empty.
+func groupText(voters map[string]bool) string {
+	if len(voters) == 0 {
+		return ":"
+	}
+	names := make([]string, 0, len(voters))
+	for userID := range voters {
+		names = append(names, "<@"+userID+">")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (c *Config) verifySigningSecret(r *http.Request) error {
+	verifier, err := slack.NewSecretsVerifier(r.Header, c.SigningSecret)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	// Need to use r.Body again when unmarshalling SlashCommand and InteractionCallback
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	verifier.Write(body)
+	return verifier.Ensure()
+}
+
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+// buildResultsBlocks renders a closed poll's final tally as Slack blocks,
+// posted in place of the poll message via update_message.
+func buildResultsBlocks(poll *store.Poll) []slack.Block {
+	headerText := slack.NewTextBlockObject("plain_text", poll.Question+" (closed)", true, false)
+	headerBlock := slack.SectionBlock{
+		Type: slack.MBTSection,
+		Text: headerText,
+	}
+
+	var summary string
+	if poll.Type == store.TypeRanked {
+		summary = rankedResultsSummary(poll)
+	} else {
+		summary = tallyResultsSummary(poll)
+	}
+	summaryBlock := slack.SectionBlock{
+		Type: slack.MBTSection,
+		Text: slack.NewTextBlockObject("mrkdwn", summary, false, false),
+	}
+
+	return []slack.Block{&headerBlock, &summaryBlock}
+}
+
+// tallyResultsSummary lists each option with its final vote count, for
+// single/multi/anonymous polls.
+func tallyResultsSummary(poll *store.Poll) string {
+	lines := make([]string, len(poll.Options))
+	for i, option := range poll.Options {
+		lines[i] = fmt.Sprintf("*%s*: %d votes", option, len(poll.Votes[i]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rankedResultsSummary reports the instant-runoff winner and a line per
+// elimination round, for ranked-choice polls.
+func rankedResultsSummary(poll *store.Poll) string {
+	winner, rounds := instantRunoff(poll)
+
+	var b strings.Builder
+	for n, round := range rounds {
+		names := make([]string, len(round.eliminated))
+		for i, opt := range round.eliminated {
+			names[i] = poll.Options[opt]
+		}
+		fmt.Fprintf(&b, "Round %d: eliminated %s\n", n+1, strings.Join(names, ", "))
+	}
+
+	if winner == -1 {
+		b.WriteString("No winner: the vote ended in a tie.")
+	} else {
+		fmt.Fprintf(&b, "*Winner: %s*", poll.Options[winner])
+	}
+	return b.String()
+}
+
+// runoffRound records one elimination step of an instant-runoff tally.
+type runoffRound struct {
+	tally      map[int]int
+	eliminated []int
+}
+
+// instantRunoff computes the ranked-choice winner: repeatedly tally each
+// active ballot's highest-ranked remaining option, eliminate whichever
+// option(s) have the fewest first-choice votes, and reassign those ballots
+// to their next chosen option, until one option holds a majority. It returns
+// -1 if every option ties out without a majority.
+func instantRunoff(poll *store.Poll) (winner int, rounds []runoffRound) {
+	active := make(map[int]bool, len(poll.Options))
+	for i := range poll.Options {
+		active[i] = true
+	}
+
+	preferences := make([][]int, 0, len(poll.Ballots))
+	for _, ballot := range poll.Ballots {
+		preferences = append(preferences, preferenceOrder(ballot))
+	}
+
+	for {
+		tally := make(map[int]int, len(active))
+		total := 0
+		for _, order := range preferences {
+			for _, option := range order {
+				if active[option] {
+					tally[option]++
+					total++
+					break
+				}
+			}
+		}
+		if total == 0 {
+			return -1, rounds
+		}
+		for option, count := range tally {
+			if count*2 > total {
+				return option, rounds
+			}
+		}
+
+		lowest := -1
+		for option := range active {
+			if lowest == -1 || tally[option] < lowest {
+				lowest = tally[option]
+			}
+		}
+		var eliminated []int
+		for option := range active {
+			if tally[option] == lowest {
+				eliminated = append(eliminated, option)
+			}
+		}
+		sort.Ints(eliminated)
+		if len(eliminated) == len(active) {
+			return -1, rounds
+		}
+
+		for _, option := range eliminated {
+			delete(active, option)
+		}
+		rounds = append(rounds, runoffRound{tally: tally, eliminated: eliminated})
+	}
+}
+
+// preferenceOrder converts a ballot (ballot[i] = the rank given to option i,
+// 0 if unranked) into the option indices in preference order. castRank
+// keeps ranks unique as ballots are built, but ties break on option index
+// here too, so a ballot built any other way still sorts deterministically
+// instead of depending on sort.Slice's unspecified tie order.
+func preferenceOrder(ballot []int) []int {
+	type ranked struct{ option, rank int }
+
+	var ranks []ranked
+	for option, rank := range ballot {
+		if rank > 0 {
+			ranks = append(ranks, ranked{option, rank})
+		}
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].rank != ranks[j].rank {
+			return ranks[i].rank < ranks[j].rank
+		}
+		return ranks[i].option < ranks[j].option
+	})
+
+	order := make([]int, len(ranks))
+	for i, r := range ranks {
+		order[i] = r.option
+	}
+	return order
+}
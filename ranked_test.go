@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+func TestPreferenceOrderBreaksTiesByOptionIndex(t *testing.T) {
+	// Options 2 and 0 are both ranked first; index 0 should sort first.
+	ballot := []int{1, 0, 1}
+	got := preferenceOrder(ballot)
+	want := []int{0, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preferenceOrder(%v) = %v, want %v", ballot, got, want)
+	}
+}
+
+func TestPreferenceOrderSkipsUnrankedOptions(t *testing.T) {
+	ballot := []int{0, 2, 1}
+	got := preferenceOrder(ballot)
+	want := []int{2, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preferenceOrder(%v) = %v, want %v", ballot, got, want)
+	}
+}
+
+func TestInstantRunoffMajorityWinnerFirstRound(t *testing.T) {
+	poll := &store.Poll{
+		Options: []string{"A", "B"},
+		Ballots: map[string][]int{
+			"u1": {1, 2},
+			"u2": {1, 2},
+			"u3": {2, 1},
+		},
+	}
+
+	winner, rounds := instantRunoff(poll)
+	if winner != 0 {
+		t.Errorf("instantRunoff winner = %d, want 0 (A)", winner)
+	}
+	if len(rounds) != 0 {
+		t.Errorf("instantRunoff rounds = %v, want none for a first-round majority", rounds)
+	}
+}
+
+func TestInstantRunoffEliminatesAndReassigns(t *testing.T) {
+	poll := &store.Poll{
+		Options: []string{"A", "B", "C"},
+		Ballots: map[string][]int{
+			"u1": {1, 2, 3}, // A, B, C
+			"u2": {1, 2, 3}, // A, B, C
+			"u3": {3, 1, 2}, // B, C, A
+			"u4": {3, 2, 1}, // C, B, A
+			"u5": {3, 2, 1}, // C, B, A
+		},
+	}
+
+	// Round 1 first choices: A=2, B=1, C=2. B is eliminated, its ballot's
+	// next choice (C) picks up u3's vote, giving C a majority.
+	winner, rounds := instantRunoff(poll)
+	if winner != 2 {
+		t.Errorf("instantRunoff winner = %d, want 2 (C)", winner)
+	}
+	if len(rounds) != 1 || len(rounds[0].eliminated) != 1 || rounds[0].eliminated[0] != 1 {
+		t.Errorf("instantRunoff rounds = %+v, want a single round eliminating option 1 (B)", rounds)
+	}
+}
+
+func TestInstantRunoffAllTiedReturnsNoWinner(t *testing.T) {
+	poll := &store.Poll{
+		Options: []string{"A", "B"},
+		Ballots: map[string][]int{
+			"u1": {1, 2},
+			"u2": {2, 1},
+		},
+	}
+
+	winner, _ := instantRunoff(poll)
+	if winner != -1 {
+		t.Errorf("instantRunoff winner = %d, want -1 for a tie", winner)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/slack-go/slack"
+
+	"github.com/ifo/slack-polls/store"
+)
+
+// downloadResultsBlockID/downloadResultsActionID identify the "Download
+// results" button, posted in its own action block at the end of every poll
+// message.
+const (
+	downloadResultsBlockID  = "download_results_block"
+	downloadResultsActionID = "download_results"
+
+	// pollResultsSubcommand re-uploads a poll's results: "/poll results <poll-id>".
+	pollResultsSubcommand = "results"
+)
+
+// downloadResultsBlock is the button that triggers a CSV + chart upload of
+// a poll's current tallies, keyed by the poll's ID.
+func downloadResultsBlock(poll *store.Poll) *slack.ActionBlock {
+	text := slack.NewTextBlockObject("plain_text", "Download results", false, false)
+	button := slack.NewButtonBlockElement(downloadResultsActionID, poll.ID, text)
+	return slack.NewActionBlock(downloadResultsBlockID, button)
+}
+
+// handleDownloadResults looks up pollID and uploads its results to channel
+// as a CSV and a bar chart PNG.
+func (c *Config) handleDownloadResults(channel, userID, pollID string) {
+	poll, err := c.Store.GetPoll(pollID)
+	if err != nil {
+		log.Printf("Error looking up poll %s for results: %v", pollID, err)
+		return
+	}
+	if err := c.uploadPollResults(channel, poll); err != nil {
+		log.Printf("Error uploading poll results: %v", err)
+	}
+}
+
+// uploadPollResults renders poll's tallies as a CSV and a bar chart PNG and
+// uploads both to channel.
+func (c *Config) uploadPollResults(channel string, poll *store.Poll) error {
+	csvBytes, err := pollResultsCSV(poll)
+	if err != nil {
+		return fmt.Errorf("rendering results CSV: %w", err)
+	}
+	if _, err := c.Client.UploadFileV2(slack.UploadFileV2Parameters{
+		Channel:  channel,
+		Reader:   bytes.NewReader(csvBytes),
+		FileSize: len(csvBytes),
+		Filename: poll.ID + "-results.csv",
+		Title:    poll.Question + " results",
+	}); err != nil {
+		return fmt.Errorf("uploading results CSV: %w", err)
+	}
+
+	chartBytes, err := pollResultsChart(poll)
+	if err != nil {
+		return fmt.Errorf("rendering results chart: %w", err)
+	}
+	if _, err := c.Client.UploadFileV2(slack.UploadFileV2Parameters{
+		Channel:  channel,
+		Reader:   bytes.NewReader(chartBytes),
+		FileSize: len(chartBytes),
+		Filename: poll.ID + "-results.png",
+		Title:    poll.Question + " chart",
+	}); err != nil {
+		return fmt.Errorf("uploading results chart: %w", err)
+	}
+	return nil
+}
+
+// voteCount reports how many votes an option has: first-choice ballots for
+// ranked polls, raw Votes count otherwise.
+func voteCount(poll *store.Poll, index int) int {
+	if poll.Type == store.TypeRanked {
+		return firstChoiceTally(poll, index)
+	}
+	return len(poll.Votes[index])
+}
+
+// voterList reports, in a stable order, the user IDs who voted an option:
+// first-choice ballots for ranked polls, Votes keys otherwise. It's always
+// empty for TypeAnonymous polls, which exist specifically to keep voter
+// identities out of view.
+func voterList(poll *store.Poll, index int) []string {
+	if poll.Type == store.TypeAnonymous {
+		return nil
+	}
+
+	var voters []string
+	if poll.Type == store.TypeRanked {
+		for userID, ballot := range poll.Ballots {
+			if index < len(ballot) && ballot[index] == 1 {
+				voters = append(voters, userID)
+			}
+		}
+	} else {
+		for userID := range poll.Votes[index] {
+			voters = append(voters, userID)
+		}
+	}
+	sort.Strings(voters)
+	return voters
+}
+
+// pollResultsCSV renders poll's tallies as CSV: one row per option, with
+// columns option, vote_count, voters (semicolon-separated user IDs, always
+// blank for TypeAnonymous polls).
+func pollResultsCSV(poll *store.Poll) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write([]string{"option", "vote_count", "voters"}); err != nil {
+		return nil, err
+	}
+	for i, option := range poll.Options {
+		row := []string{option, strconv.Itoa(voteCount(poll, i)), strings.Join(voterList(poll, i), ";")}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Layout constants for pollResultsChart's hand-drawn bar chart.
+const (
+	chartWidth      = 600
+	chartMargin     = 10
+	chartLabelWidth = 160
+	chartBarHeight  = 30
+	chartBarGap     = 10
+)
+
+var chartBarColor = color.RGBA{0x36, 0x78, 0xd6, 0xff}
+
+// pollResultsChart renders poll's tallies as a PNG bar chart, one bar per
+// option with its label to the left, bar widths proportional to the
+// highest tally.
+func pollResultsChart(poll *store.Poll) ([]byte, error) {
+	counts := make([]int, len(poll.Options))
+	max := 0
+	for i := range poll.Options {
+		counts[i] = voteCount(poll, i)
+		if counts[i] > max {
+			max = counts[i]
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	height := chartMargin*2 + len(poll.Options)*(chartBarHeight+chartBarGap)
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	barAreaWidth := chartWidth - chartLabelWidth - chartMargin
+	for i, option := range poll.Options {
+		y := chartMargin + i*(chartBarHeight+chartBarGap)
+		drawLabel(img, chartMargin, y+chartBarHeight/2+4, fmt.Sprintf("%s (%d)", option, counts[i]))
+
+		barWidth := counts[i] * barAreaWidth / max
+		bar := image.Rect(chartLabelWidth, y, chartLabelWidth+barWidth, y+chartBarHeight)
+		draw.Draw(img, bar, image.NewUniform(chartBarColor), image.Point{}, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLabel draws text in black with its baseline at (x, y).
+func drawLabel(img *image.RGBA, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.Black),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// optionResultJSON is one option's tally, as served by PollResultsHandler.
+// Voters is omitted for TypeAnonymous polls (see voterList).
+type optionResultJSON struct {
+	Option string   `json:"option"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// pollResultsJSON is the body served by PollResultsHandler.
+type pollResultsJSON struct {
+	ID       string             `json:"id"`
+	Question string             `json:"question"`
+	Type     string             `json:"type"`
+	Results  []optionResultJSON `json:"results"`
+}
+
+// PollResultsHandler serves "GET /polls/{id}/results.json": a poll's
+// current tallies as structured JSON, for external dashboards to poll.
+func (c *Config) PollResultsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := c.verifySigningSecret(r); err != nil {
+		log.Printf("Error verifying signing secret: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/polls/"), "/results.json")
+	if !ok || id == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	poll, err := c.Store.GetPoll(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	results := make([]optionResultJSON, len(poll.Options))
+	for i, option := range poll.Options {
+		results[i] = optionResultJSON{Option: option, Votes: voteCount(poll, i), Voters: voterList(poll, i)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pollResultsJSON{
+		ID:       poll.ID,
+		Question: poll.Question,
+		Type:     string(poll.Type),
+		Results:  results,
+	}); err != nil {
+		log.Printf("Error encoding poll results: %v", err)
+	}
+}
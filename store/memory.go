@@ -0,0 +1,237 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-memory PollStore. It's the default store and is also
+// useful in tests; state doesn't survive a process restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	polls map[string]*Poll
+	auth  map[string]*authSession
+}
+
+// authSession holds a user's enrolled TOTP secret, how long their most
+// recent successful code check authorizes them for, and their consecutive
+// failed-attempt/lockout state.
+type authSession struct {
+	secret          string
+	authorizedUntil time.Time
+	failedAttempts  int
+	lockedUntil     time.Time
+}
+
+// NewMemoryStore returns an empty in-memory poll store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		polls: make(map[string]*Poll),
+		auth:  make(map[string]*authSession),
+	}
+}
+
+func (s *MemoryStore) CreatePoll(poll *Poll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if poll.ID == "" {
+		poll.ID = uuid.NewString()
+	}
+	poll.Open = true
+	if poll.Ballots == nil {
+		poll.Ballots = make(map[string][]int)
+	}
+	s.polls[poll.ID] = poll
+	return nil
+}
+
+// GetPoll returns a copy of the stored poll, so the caller can read or hold
+// onto it without racing a concurrent vote.
+func (s *MemoryStore) GetPoll(id string) (*Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return poll.clone(), nil
+}
+
+func (s *MemoryStore) GetPollByMessage(teamID, channelID, messageTS string) (*Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, poll := range s.polls {
+		if poll.TeamID == teamID && poll.ChannelID == channelID && poll.MessageTS == messageTS {
+			return poll.clone(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) AddVote(pollID string, index int, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return ErrNotFound
+	}
+	if index < 0 || index >= len(poll.Votes) {
+		return errors.New("store: option index out of range")
+	}
+	poll.Votes[index][userID] = true
+	return nil
+}
+
+func (s *MemoryStore) RemoveVote(pollID string, index int, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return ErrNotFound
+	}
+	if index < 0 || index >= len(poll.Votes) {
+		return errors.New("store: option index out of range")
+	}
+	delete(poll.Votes[index], userID)
+	return nil
+}
+
+func (s *MemoryStore) SetBallot(pollID, userID string, ranking []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return ErrNotFound
+	}
+	if poll.Ballots == nil {
+		poll.Ballots = make(map[string][]int)
+	}
+	poll.Ballots[userID] = ranking
+	return nil
+}
+
+func (s *MemoryStore) ClosePoll(pollID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return ErrNotFound
+	}
+	poll.Open = false
+	return nil
+}
+
+func (s *MemoryStore) ListOpenPolls(teamID string) ([]*Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var open []*Poll
+	for _, poll := range s.polls {
+		if poll.TeamID == teamID && poll.Open {
+			open = append(open, poll.clone())
+		}
+	}
+	return open, nil
+}
+
+func (s *MemoryStore) SaveAuthSecret(userID, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess := s.auth[userID]
+	if sess == nil {
+		sess = &authSession{}
+		s.auth[userID] = sess
+	}
+	sess.secret = secret
+	return nil
+}
+
+func (s *MemoryStore) GetAuthSecret(userID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.auth[userID]
+	if !ok || sess.secret == "" {
+		return "", false, nil
+	}
+	return sess.secret, true, nil
+}
+
+func (s *MemoryStore) Authorize(userID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess := s.auth[userID]
+	if sess == nil {
+		sess = &authSession{}
+		s.auth[userID] = sess
+	}
+	sess.authorizedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) IsSessionAuthorized(userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.auth[userID]
+	if !ok {
+		return false, nil
+	}
+	return time.Now().Before(sess.authorizedUntil), nil
+}
+
+func (s *MemoryStore) RecordAuthFailure(userID string, maxAttempts int, lockout time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess := s.auth[userID]
+	if sess == nil {
+		sess = &authSession{}
+		s.auth[userID] = sess
+	}
+
+	sess.failedAttempts++
+	if sess.failedAttempts < maxAttempts {
+		return time.Time{}, nil
+	}
+
+	sess.failedAttempts = 0
+	sess.lockedUntil = time.Now().Add(lockout)
+	return sess.lockedUntil, nil
+}
+
+func (s *MemoryStore) ResetAuthFailures(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.auth[userID]
+	if !ok {
+		return nil
+	}
+	sess.failedAttempts = 0
+	sess.lockedUntil = time.Time{}
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(userID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.auth[userID]
+	if !ok {
+		return time.Time{}, nil
+	}
+	return sess.lockedUntil, nil
+}
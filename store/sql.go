@@ -0,0 +1,413 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLStore is a PollStore backed by database/sql. It works against either
+// SQLite or Postgres; the differences between the two are the driver name,
+// the placeholder style used when preparing statements, and the row-lock
+// suffix (see selectForUpdateSuffix).
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+// NewSQLStore opens db and ensures the polls/auth_sessions tables exist. driver must
+// be "sqlite3" or "postgres".
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: open %s: %w", driver, err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("store: ping %s: %w", driver, err)
+	}
+
+	s := &SQLStore{db: db, driver: driver}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) migrate() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS polls (
+			id TEXT PRIMARY KEY,
+			team_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			message_ts TEXT NOT NULL,
+			question TEXT NOT NULL,
+			poll_type TEXT NOT NULL,
+			creator_id TEXT NOT NULL DEFAULT '',
+			options TEXT NOT NULL,
+			votes TEXT NOT NULL,
+			ballots TEXT NOT NULL,
+			open BOOLEAN NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS auth_sessions (
+			user_id TEXT PRIMARY KEY,
+			secret TEXT NOT NULL DEFAULT '',
+			authorized_until TIMESTAMP,
+			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until TIMESTAMP
+		)
+	`)
+	return err
+}
+
+func (s *SQLStore) CreatePoll(poll *Poll) error {
+	if poll.ID == "" {
+		poll.ID = uuid.NewString()
+	}
+	poll.Open = true
+	if poll.Ballots == nil {
+		poll.Ballots = make(map[string][]int)
+	}
+
+	options, err := json.Marshal(poll.Options)
+	if err != nil {
+		return err
+	}
+	votes, err := json.Marshal(poll.Votes)
+	if err != nil {
+		return err
+	}
+	ballots, err := json.Marshal(poll.Ballots)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		s.rebind(`INSERT INTO polls (id, team_id, channel_id, message_ts, question, poll_type, creator_id, options, votes, ballots, open, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		poll.ID, poll.TeamID, poll.ChannelID, poll.MessageTS, poll.Question, poll.Type, poll.CreatorID, options, votes, ballots, poll.Open, poll.CreatedAt,
+	)
+	return err
+}
+
+func (s *SQLStore) GetPoll(id string) (*Poll, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT id, team_id, channel_id, message_ts, question, poll_type, creator_id, options, votes, ballots, open, created_at
+		FROM polls WHERE id = ?`), id)
+	return scanPoll(row)
+}
+
+func (s *SQLStore) GetPollByMessage(teamID, channelID, messageTS string) (*Poll, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT id, team_id, channel_id, message_ts, question, poll_type, creator_id, options, votes, ballots, open, created_at
+		FROM polls WHERE team_id = ? AND channel_id = ? AND message_ts = ?`), teamID, channelID, messageTS)
+	return scanPoll(row)
+}
+
+func (s *SQLStore) AddVote(pollID string, index int, userID string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		poll, err := s.getPollTx(tx, pollID)
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(poll.Votes) {
+			return fmt.Errorf("store: option index out of range")
+		}
+		poll.Votes[index][userID] = true
+		return s.saveVotesTx(tx, poll)
+	})
+}
+
+func (s *SQLStore) RemoveVote(pollID string, index int, userID string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		poll, err := s.getPollTx(tx, pollID)
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= len(poll.Votes) {
+			return fmt.Errorf("store: option index out of range")
+		}
+		delete(poll.Votes[index], userID)
+		return s.saveVotesTx(tx, poll)
+	})
+}
+
+func (s *SQLStore) saveVotesTx(tx *sql.Tx, poll *Poll) error {
+	votes, err := json.Marshal(poll.Votes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.rebind(`UPDATE polls SET votes = ? WHERE id = ?`), votes, poll.ID)
+	return err
+}
+
+func (s *SQLStore) SetBallot(pollID, userID string, ranking []int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		poll, err := s.getPollTx(tx, pollID)
+		if err != nil {
+			return err
+		}
+		if poll.Ballots == nil {
+			poll.Ballots = make(map[string][]int)
+		}
+		poll.Ballots[userID] = ranking
+
+		ballots, err := json.Marshal(poll.Ballots)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(s.rebind(`UPDATE polls SET ballots = ? WHERE id = ?`), ballots, poll.ID)
+		return err
+	})
+}
+
+func (s *SQLStore) ClosePoll(pollID string) error {
+	_, err := s.db.Exec(s.rebind(`UPDATE polls SET open = ? WHERE id = ?`), false, pollID)
+	return err
+}
+
+func (s *SQLStore) ListOpenPolls(teamID string) ([]*Poll, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT id, team_id, channel_id, message_ts, question, poll_type, creator_id, options, votes, ballots, open, created_at
+		FROM polls WHERE team_id = ? AND open = ?`), teamID, true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []*Poll
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return nil, err
+		}
+		polls = append(polls, poll)
+	}
+	return polls, rows.Err()
+}
+
+func (s *SQLStore) SaveAuthSecret(userID, secret string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := s.authRowTx(tx, userID); err == sql.ErrNoRows {
+			_, err := tx.Exec(s.rebind(`INSERT INTO auth_sessions (user_id, secret) VALUES (?, ?)`), userID, secret)
+			return err
+		} else if err != nil {
+			return err
+		}
+		_, err := tx.Exec(s.rebind(`UPDATE auth_sessions SET secret = ? WHERE user_id = ?`), secret, userID)
+		return err
+	})
+}
+
+func (s *SQLStore) GetAuthSecret(userID string) (string, bool, error) {
+	secret, err := s.authRow(userID)
+	if err == sql.ErrNoRows || secret == "" {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// authRow returns userID's enrolled secret, or sql.ErrNoRows if they've
+// never run SaveAuthSecret.
+func (s *SQLStore) authRow(userID string) (string, error) {
+	var secret string
+	err := s.db.QueryRow(s.rebind(`SELECT secret FROM auth_sessions WHERE user_id = ?`), userID).Scan(&secret)
+	return secret, err
+}
+
+// authRowTx is authRow's transaction-scoped counterpart, used so an
+// existence check and the update it guards can't race against a concurrent
+// call for the same userID. When no row exists there is nothing to lock, so
+// two concurrent first-time calls both insert and one of them fails on the
+// user_id primary key.
+func (s *SQLStore) authRowTx(tx *sql.Tx, userID string) (string, error) {
+	var secret string
+	err := tx.QueryRow(s.rebind(`SELECT secret FROM auth_sessions WHERE user_id = ?`+s.selectForUpdateSuffix()), userID).Scan(&secret)
+	return secret, err
+}
+
+func (s *SQLStore) Authorize(userID string, until time.Time) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := s.authRowTx(tx, userID); err == sql.ErrNoRows {
+			_, err := tx.Exec(s.rebind(`INSERT INTO auth_sessions (user_id, authorized_until) VALUES (?, ?)`), userID, until)
+			return err
+		} else if err != nil {
+			return err
+		}
+		_, err := tx.Exec(s.rebind(`UPDATE auth_sessions SET authorized_until = ? WHERE user_id = ?`), until, userID)
+		return err
+	})
+}
+
+func (s *SQLStore) IsSessionAuthorized(userID string) (bool, error) {
+	var until sql.NullTime
+	err := s.db.QueryRow(s.rebind(`SELECT authorized_until FROM auth_sessions WHERE user_id = ?`), userID).Scan(&until)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return until.Valid && time.Now().Before(until.Time), nil
+}
+
+func (s *SQLStore) RecordAuthFailure(userID string, maxAttempts int, lockout time.Duration) (time.Time, error) {
+	var lockedUntil time.Time
+	err := s.withTx(func(tx *sql.Tx) error {
+		var attempts int
+		err := tx.QueryRow(s.rebind(`SELECT failed_attempts FROM auth_sessions WHERE user_id = ?`+s.selectForUpdateSuffix()), userID).Scan(&attempts)
+		switch {
+		case err == sql.ErrNoRows:
+			attempts = 0
+			_, err = tx.Exec(s.rebind(`INSERT INTO auth_sessions (user_id, failed_attempts) VALUES (?, ?)`), userID, 0)
+			if err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		attempts++
+		if attempts < maxAttempts {
+			_, err := tx.Exec(s.rebind(`UPDATE auth_sessions SET failed_attempts = ? WHERE user_id = ?`), attempts, userID)
+			return err
+		}
+
+		lockedUntil = time.Now().Add(lockout)
+		_, err = tx.Exec(s.rebind(`UPDATE auth_sessions SET failed_attempts = 0, locked_until = ? WHERE user_id = ?`), lockedUntil, userID)
+		return err
+	})
+	return lockedUntil, err
+}
+
+func (s *SQLStore) ResetAuthFailures(userID string) error {
+	_, err := s.db.Exec(s.rebind(`UPDATE auth_sessions SET failed_attempts = 0, locked_until = NULL WHERE user_id = ?`), userID)
+	return err
+}
+
+func (s *SQLStore) LockedUntil(userID string) (time.Time, error) {
+	var until sql.NullTime
+	err := s.db.QueryRow(s.rebind(`SELECT locked_until FROM auth_sessions WHERE user_id = ?`), userID).Scan(&until)
+	if err == sql.ErrNoRows || !until.Valid {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// withTx runs fn inside a transaction, committing if it returns nil and
+// rolling back otherwise. Store methods that read a row and write it back
+// (votes, ballots, auth sessions) use this so a concurrent call for the
+// same row can't interleave and lose an update.
+func (s *SQLStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// getPollTx looks up a poll within tx, locking its row against concurrent
+// writers where the driver supports it.
+func (s *SQLStore) getPollTx(tx *sql.Tx, id string) (*Poll, error) {
+	query := s.rebind(`SELECT id, team_id, channel_id, message_ts, question, poll_type, creator_id, options, votes, ballots, open, created_at
+		FROM polls WHERE id = ?` + s.selectForUpdateSuffix())
+	row := tx.QueryRow(query, id)
+	return scanPoll(row)
+}
+
+// selectForUpdateSuffix appends a row-lock hint for drivers that support
+// it inside a transaction. SQLite has no equivalent; it serializes writers
+// at the connection/database level instead, so the transaction alone is
+// enough to make a withTx call atomic.
+func (s *SQLStore) selectForUpdateSuffix() string {
+	if s.driver == "postgres" {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPoll(row scanner) (*Poll, error) {
+	var (
+		poll        Poll
+		optionsJSON string
+		votesJSON   string
+		ballotsJSON string
+	)
+	err := row.Scan(&poll.ID, &poll.TeamID, &poll.ChannelID, &poll.MessageTS, &poll.Question, &poll.Type, &poll.CreatorID,
+		&optionsJSON, &votesJSON, &ballotsJSON, &poll.Open, &poll.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(optionsJSON), &poll.Options); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(votesJSON), &poll.Votes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(ballotsJSON), &poll.Ballots); err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for Postgres; SQLite accepts
+// ? natively.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	n := 0
+	out := make([]byte, 0, len(query)+8)
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			out = append(out, fmt.Sprintf("$%d", n)...)
+			continue
+		}
+		out = append(out, query[i])
+	}
+	return string(out)
+}
+
+// NewFromEnv builds the PollStore selected by STORE_DRIVER ("memory" by
+// default, or "sqlite"/"postgres" with STORE_DSN pointing at the database).
+func NewFromEnv() (PollStore, error) {
+	driver := os.Getenv("STORE_DRIVER")
+	switch driver {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "sqlite":
+		return NewSQLStore("sqlite3", os.Getenv("STORE_DSN"))
+	case "postgres":
+		return NewSQLStore("postgres", os.Getenv("STORE_DSN"))
+	default:
+		return nil, fmt.Errorf("store: unknown STORE_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,118 @@
+// Package store persists polls so their state no longer has to live inside
+// the Slack message text itself. A Poll is keyed by the workspace/channel/
+// message it was posted as, which lets a single bot process serve polls for
+// more than one team at once.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by PollStore implementations when a poll, or a
+// lookup key for one, doesn't exist.
+var ErrNotFound = errors.New("store: poll not found")
+
+// Type selects a poll's voting semantics.
+type Type string
+
+const (
+	TypeSingle    Type = "single"    // one active choice per user
+	TypeMulti     Type = "multi"     // a user may hold several choices at once
+	TypeAnonymous Type = "anonymous" // single choice, but voters aren't shown
+	TypeRanked    Type = "ranked"    // users rank every option, winner by instant-runoff
+)
+
+// Poll is the persisted state of a single poll: its options and the set of
+// users who voted for each one.
+type Poll struct {
+	ID        string
+	TeamID    string
+	ChannelID string
+	MessageTS string
+	Question  string
+	Type      Type
+	// CreatorID is the Slack user ID of whoever submitted the poll-creation
+	// modal, e.g. so a "close my poll" keyword can be scoped to its author.
+	CreatorID string
+	Options   []string
+	// Votes[i] is the set of user IDs (e.g. "U12345") who voted for Options[i].
+	// Unused for TypeRanked polls, which vote via Ballots instead.
+	Votes []map[string]bool
+	// Ballots[userID][i] is the rank (1 = first choice) userID gave
+	// Options[i], or 0 if they haven't ranked it. Only used for TypeRanked.
+	Ballots   map[string][]int
+	Open      bool
+	CreatedAt time.Time
+}
+
+// clone returns a deep copy of p, so a caller mutating the result (or
+// reading it concurrently with a write) can't race with the store's own
+// internal state.
+func (p *Poll) clone() *Poll {
+	if p == nil {
+		return nil
+	}
+
+	c := *p
+	c.Options = append([]string(nil), p.Options...)
+
+	c.Votes = make([]map[string]bool, len(p.Votes))
+	for i, voters := range p.Votes {
+		c.Votes[i] = make(map[string]bool, len(voters))
+		for userID, voted := range voters {
+			c.Votes[i][userID] = voted
+		}
+	}
+
+	c.Ballots = make(map[string][]int, len(p.Ballots))
+	for userID, ranking := range p.Ballots {
+		c.Ballots[userID] = append([]int(nil), ranking...)
+	}
+
+	return &c
+}
+
+// PollStore is the persistence interface for polls. Implementations must be
+// safe for concurrent use.
+type PollStore interface {
+	// CreatePoll assigns the poll an ID (if empty) and persists it.
+	CreatePoll(poll *Poll) error
+	// GetPoll looks up a poll by its ID.
+	GetPoll(id string) (*Poll, error)
+	// GetPollByMessage looks up a poll by the Slack message it was posted as.
+	GetPollByMessage(teamID, channelID, messageTS string) (*Poll, error)
+	// AddVote records that userID voted for the option at index.
+	AddVote(pollID string, index int, userID string) error
+	// RemoveVote removes userID's vote for the option at index, if present.
+	RemoveVote(pollID string, index int, userID string) error
+	// SetBallot replaces userID's full ranking for a TypeRanked poll.
+	SetBallot(pollID, userID string, ranking []int) error
+	// ClosePoll marks a poll as no longer accepting votes.
+	ClosePoll(pollID string) error
+	// ListOpenPolls returns every open poll for a team.
+	ListOpenPolls(teamID string) ([]*Poll, error)
+
+	// SaveAuthSecret stores (replacing any existing one) the TOTP secret
+	// enrolled for userID.
+	SaveAuthSecret(userID, secret string) error
+	// GetAuthSecret returns the TOTP secret enrolled for userID, if any.
+	GetAuthSecret(userID string) (secret string, ok bool, err error)
+	// Authorize marks userID as authorized until the given time.
+	Authorize(userID string, until time.Time) error
+	// IsSessionAuthorized reports whether userID currently has an
+	// unexpired authorization from Authorize.
+	IsSessionAuthorized(userID string) (bool, error)
+
+	// RecordAuthFailure increments userID's consecutive failed /poll auth
+	// attempts and, once that reaches maxAttempts, locks them out for
+	// lockout (resetting the count). It returns the lockout expiry, or the
+	// zero time if userID isn't (newly) locked out.
+	RecordAuthFailure(userID string, maxAttempts int, lockout time.Duration) (time.Time, error)
+	// ResetAuthFailures clears userID's failed-attempt count and any
+	// lockout, after a successful code check.
+	ResetAuthFailures(userID string) error
+	// LockedUntil reports when userID's lockout, if any, expires. It
+	// returns the zero time if they aren't locked out.
+	LockedUntil(userID string) (time.Time, error)
+}